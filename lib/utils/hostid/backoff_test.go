@@ -0,0 +1,70 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package hostid
+
+import (
+	"crypto/rand"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// flakyReader fails with io.ErrUnexpectedEOF for the first failCount reads,
+// simulating /dev/urandom not being seeded yet at early boot, then falls
+// back to crypto/rand.Reader.
+type flakyReader struct {
+	failCount int
+}
+
+func (r *flakyReader) Read(p []byte) (int, error) {
+	if r.failCount > 0 {
+		r.failCount--
+		return 0, io.ErrUnexpectedEOF
+	}
+	return rand.Reader.Read(p)
+}
+
+func TestGenerateUUIDRetriesTransientReadErrors(t *testing.T) {
+	reader := &flakyReader{failCount: 3}
+
+	id, err := generateUUID(Options{RandReader: reader, RandWait: time.Second})
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+	require.Zero(t, reader.failCount)
+}
+
+func TestGenerateUUIDGivesUpAfterRandWait(t *testing.T) {
+	reader := &flakyReader{failCount: 1_000_000}
+
+	_, err := generateUUID(Options{RandReader: reader, RandWait: 10 * time.Millisecond})
+	require.Error(t, err)
+}
+
+func TestGenerateUUIDPermanentReadError(t *testing.T) {
+	_, err := generateUUID(Options{Version: VersionV4, RandReader: errReader{}})
+	require.Error(t, err)
+}
+
+// errReader always fails with a non-transient error, so generateUUID must
+// not retry it.
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
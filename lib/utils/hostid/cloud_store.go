@@ -0,0 +1,181 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package hostid
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gravitational/trace"
+)
+
+// cloudMetadataNamespace is used to derive a stable, RFC 4122 v5 UUID from
+// each cloud provider's instance identifier, so the same instance always
+// maps to the same host UUID without the provider having to hand out
+// UUID-shaped IDs itself.
+var cloudMetadataNamespace = uuid.MustParse("ad6a3e38-0a5d-4a2e-8a1b-77e5d6b2f9b1")
+
+// instanceIDFetcher retrieves the stable identifier a cloud provider assigns
+// to the instance Teleport is running on.
+type instanceIDFetcher interface {
+	// name identifies the provider, used only for error messages.
+	name() string
+	fetchInstanceID(ctx context.Context, client *http.Client) (string, error)
+}
+
+// CloudMetadataStore is a Store that derives the host UUID from a cloud
+// provider's instance metadata service, so the identity survives a rebuild
+// of the data directory as long as the underlying instance doesn't change.
+// The derived UUID is cached to disk so that restarts don't need network
+// access to the metadata service.
+type CloudMetadataStore struct {
+	dataDir string
+	fetcher instanceIDFetcher
+	client  *http.Client
+}
+
+func newCloudMetadataStore(dataDir string, fetcher instanceIDFetcher) *CloudMetadataStore {
+	return &CloudMetadataStore{
+		dataDir: dataDir,
+		fetcher: fetcher,
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Read implements Store.
+func (s *CloudMetadataStore) Read(ctx context.Context) (string, error) {
+	return ReadFile(s.dataDir)
+}
+
+// WriteIfAbsent implements Store. The id argument is ignored: the host
+// UUID is always derived from the instance ID reported by the cloud
+// provider, not generated randomly.
+func (s *CloudMetadataStore) WriteIfAbsent(ctx context.Context, _ string) (string, error) {
+	if read, err := s.Read(ctx); err == nil {
+		return read, nil
+	} else if !trace.IsNotFound(err) {
+		return "", trace.Wrap(err)
+	}
+
+	instanceID, err := s.fetcher.fetchInstanceID(ctx, s.client)
+	if err != nil {
+		return "", trace.Wrap(err, "fetching %s instance metadata", s.fetcher.name())
+	}
+
+	derived := uuid.NewSHA1(cloudMetadataNamespace, []byte(instanceID)).String()
+	if err := WriteFile(s.dataDir, derived); err != nil {
+		return "", trace.Wrap(err)
+	}
+	return derived, nil
+}
+
+// NewAWSMetadataStore returns a Store that derives the host UUID from the
+// instance ID reported by the EC2 Instance Metadata Service (IMDSv2).
+func NewAWSMetadataStore(dataDir string) *CloudMetadataStore {
+	return newCloudMetadataStore(dataDir, awsFetcher{})
+}
+
+// NewGCPMetadataStore returns a Store that derives the host UUID from the
+// instance ID reported by the GCE metadata server.
+func NewGCPMetadataStore(dataDir string) *CloudMetadataStore {
+	return newCloudMetadataStore(dataDir, gcpFetcher{})
+}
+
+// NewAzureMetadataStore returns a Store that derives the host UUID from the
+// vmId reported by Azure Instance Metadata Service.
+func NewAzureMetadataStore(dataDir string) *CloudMetadataStore {
+	return newCloudMetadataStore(dataDir, azureFetcher{})
+}
+
+type awsFetcher struct{}
+
+func (awsFetcher) name() string { return "AWS" }
+
+func (awsFetcher) fetchInstanceID(ctx context.Context, client *http.Client) (string, error) {
+	tokenReq, err := http.NewRequestWithContext(ctx, http.MethodPut, "http://169.254.169.254/latest/api/token", nil)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	tokenReq.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+
+	token, err := doMetadataRequest(client, tokenReq)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+
+	idReq, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://169.254.169.254/latest/meta-data/instance-id", nil)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	idReq.Header.Set("X-aws-ec2-metadata-token", token)
+
+	return doMetadataRequest(client, idReq)
+}
+
+type gcpFetcher struct{}
+
+func (gcpFetcher) name() string { return "GCP" }
+
+func (gcpFetcher) fetchInstanceID(ctx context.Context, client *http.Client) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://metadata.google.internal/computeMetadata/v1/instance/id", nil)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	return doMetadataRequest(client, req)
+}
+
+type azureFetcher struct{}
+
+func (azureFetcher) name() string { return "Azure" }
+
+func (azureFetcher) fetchInstanceID(ctx context.Context, client *http.Client) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"http://169.254.169.254/metadata/instance/compute/vmId?api-version=2021-02-01&format=text", nil)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	req.Header.Set("Metadata", "true")
+
+	return doMetadataRequest(client, req)
+}
+
+func doMetadataRequest(client *http.Client, req *http.Request) (string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", trace.BadParameter("metadata service returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	// Some providers/proxies pad the response with a trailing newline; left
+	// untrimmed, it would either break the AWS token header or silently
+	// change the instance ID the host UUID is derived from.
+	return strings.TrimSpace(string(body)), nil
+}
@@ -0,0 +1,89 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package hostid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFetcher lets tests exercise CloudMetadataStore.WriteIfAbsent without
+// a real instanceIDFetcher talking to a cloud metadata endpoint.
+type fakeFetcher struct {
+	instanceID string
+}
+
+func (fakeFetcher) name() string { return "fake" }
+
+func (f fakeFetcher) fetchInstanceID(ctx context.Context, client *http.Client) (string, error) {
+	return f.instanceID, nil
+}
+
+func TestCloudMetadataStoreWriteIfAbsent(t *testing.T) {
+	ctx := context.Background()
+	store := newCloudMetadataStore(t.TempDir(), fakeFetcher{instanceID: "i-0123456789abcdef0"})
+
+	_, err := store.Read(ctx)
+	require.Error(t, err)
+
+	first, err := store.WriteIfAbsent(ctx, "ignored")
+	require.NoError(t, err)
+	require.NotEmpty(t, first)
+
+	// The same instance ID must always derive the same UUID.
+	other := newCloudMetadataStore(t.TempDir(), fakeFetcher{instanceID: "i-0123456789abcdef0"})
+	derived, err := other.WriteIfAbsent(ctx, "ignored")
+	require.NoError(t, err)
+	require.Equal(t, first, derived)
+
+	// A second WriteIfAbsent on the same store must not re-derive.
+	store.fetcher = fakeFetcher{instanceID: "i-fedcba9876543210f"}
+	again, err := store.WriteIfAbsent(ctx, "ignored")
+	require.NoError(t, err)
+	require.Equal(t, first, again)
+}
+
+func TestDoMetadataRequestTrimsResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("i-0123456789abcdef0\n"))
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+
+	body, err := doMetadataRequest(srv.Client(), req)
+	require.NoError(t, err)
+	require.Equal(t, "i-0123456789abcdef0", body)
+}
+
+func TestDoMetadataRequestNonOKStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+
+	_, err = doMetadataRequest(srv.Client(), req)
+	require.Error(t, err)
+}
\ No newline at end of file
@@ -19,12 +19,12 @@
 package hostid
 
 import (
+	"context"
 	"errors"
 	"io/fs"
 	"time"
 
 	"github.com/google/renameio/v2"
-	"github.com/google/uuid"
 	"github.com/gravitational/trace"
 
 	"github.com/gravitational/teleport/lib/utils"
@@ -43,63 +43,106 @@ func WriteFile(dataDir string, id string) error {
 	return nil
 }
 
-// ReadOrCreateFile looks for a hostid file in the data dir. If present,
-// returns the UUID from it, otherwise generates one
-func ReadOrCreateFile(dataDir string) (string, error) {
-	hostUUIDFileLock := GetPath(dataDir) + ".lock"
-	const iterationLimit = 3
+// FileStore is the default Store implementation, rooting host identity in a
+// file under the node's data directory. It is guarded by an on-disk lock so
+// that multiple Teleport processes sharing a data dir never write
+// conflicting UUIDs.
+type FileStore struct {
+	dataDir string
+}
 
-	for i := 0; i < iterationLimit; i++ {
-		if read, err := ReadFile(dataDir); err == nil {
-			return read, nil
-		} else if !trace.IsNotFound(err) {
-			return "", trace.Wrap(err)
-		}
+// NewFileStore returns a Store that persists the host UUID to a file under
+// dataDir.
+func NewFileStore(dataDir string) *FileStore {
+	return &FileStore{dataDir: dataDir}
+}
 
-		// Checking error instead of the usual uuid.New() in case uuid generation
-		// fails due to not enough randomness. It's been known to happen happen when
-		// Teleport starts very early in the node initialization cycle and /dev/urandom
-		// isn't ready yet.
-		rawID, err := uuid.NewRandom()
-		if err != nil {
-			return "", trace.BadParameter("" +
-				"Teleport failed to generate host UUID. " +
-				"This may happen if randomness source is not fully initialized when the node is starting up. " +
-				"Please try restarting Teleport again.")
-		}
+// Read implements Store.
+func (s *FileStore) Read(ctx context.Context) (string, error) {
+	return ReadFile(s.dataDir)
+}
 
-		writeFile := func(potentialID string) (string, error) {
+// WriteIfAbsent implements Store. It takes an exclusive lock on a sibling
+// `.lock` file, re-checks for a concurrently-written UUID, and only then
+// writes ours -- the fs-locking semantics ReadOrCreateFile has always used.
+func (s *FileStore) WriteIfAbsent(ctx context.Context, id string) (string, error) {
+	hostUUIDFileLock := GetPath(s.dataDir) + ".lock"
+	const iterationLimit = 3
+
+	for i := 0; i < iterationLimit; i++ {
+		written, err := func() (string, error) {
 			unlock, err := utils.FSTryWriteLock(hostUUIDFileLock)
 			if err != nil {
 				return "", trace.Wrap(err)
 			}
 			defer unlock()
 
-			if read, err := ReadFile(dataDir); err == nil {
+			if read, err := ReadFile(s.dataDir); err == nil {
 				return read, nil
 			} else if !trace.IsNotFound(err) {
 				return "", trace.Wrap(err)
 			}
 
-			if err := WriteFile(dataDir, potentialID); err != nil {
+			if err := WriteFile(s.dataDir, id); err != nil {
 				return "", trace.Wrap(err)
 			}
 
-			return potentialID, nil
-		}
-
-		id, err := writeFile(rawID.String())
+			return id, nil
+		}()
 		if err != nil {
 			if errors.Is(err, utils.ErrUnsuccessfulLockTry) {
 				time.Sleep(10 * time.Millisecond)
 				continue
 			}
-
 			return "", trace.Wrap(err)
 		}
 
-		return id, nil
+		return written, nil
 	}
 
 	return "", trace.LimitExceeded("failed to obtain host uuid")
 }
+
+// ReadOrCreateFile looks for a hostid file in the data dir. If present,
+// returns the UUID from it, otherwise generates one.
+func ReadOrCreateFile(dataDir string) (string, error) {
+	return ReadOrCreate(context.Background(), NewFileStore(dataDir), Options{})
+}
+
+// ReadOrCreateFileWithOptions looks for a hostid file in the data dir. If
+// present, returns the UUID from it, otherwise generates one according to
+// opts, and records its actual version and creation time in a sibling
+// "host_uuid.meta" file. The version recorded is always the one parsed back
+// out of the UUID, not opts.Version, so a v4 ID that predates an operator
+// opting into v7 doesn't get mislabeled. If the UUID exists but a prior
+// call died before writing host_uuid.meta, it is written now instead of
+// being lost for good.
+func ReadOrCreateFileWithOptions(dataDir string, opts Options) (string, error) {
+	id, err := ReadOrCreate(context.Background(), NewFileStore(dataDir), opts)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+
+	if metaExists(dataDir) {
+		return id, nil
+	}
+
+	info, err := Parse(id)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+
+	// VersionV7 encodes its own creation time; VersionV4 doesn't, so the
+	// best we can do is the time we first noticed host_uuid.meta was
+	// missing -- exact for a UUID generated by this call, approximate for
+	// one that predates this feature.
+	createdAt := info.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	if err := writeMeta(dataDir, info.Version, createdAt); err != nil {
+		return "", trace.Wrap(err)
+	}
+	return id, nil
+}
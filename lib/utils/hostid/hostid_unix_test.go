@@ -0,0 +1,119 @@
+//go:build !windows
+
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package hostid
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/gravitational/trace"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStoreReadWriteIfAbsent(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileStore(t.TempDir())
+
+	_, err := store.Read(ctx)
+	require.True(t, trace.IsNotFound(err))
+
+	first, err := store.WriteIfAbsent(ctx, "11111111-1111-4111-8111-111111111111")
+	require.NoError(t, err)
+	require.Equal(t, "11111111-1111-4111-8111-111111111111", first)
+
+	// A second WriteIfAbsent must not clobber the first UUID.
+	second, err := store.WriteIfAbsent(ctx, "22222222-2222-4222-8222-222222222222")
+	require.NoError(t, err)
+	require.Equal(t, first, second)
+
+	read, err := store.Read(ctx)
+	require.NoError(t, err)
+	require.Equal(t, first, read)
+}
+
+func TestReadOrCreateFile(t *testing.T) {
+	dataDir := t.TempDir()
+
+	id, err := ReadOrCreateFile(dataDir)
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+
+	again, err := ReadOrCreateFile(dataDir)
+	require.NoError(t, err)
+	require.Equal(t, id, again)
+}
+
+func TestReadOrCreateFileWithOptionsWritesMeta(t *testing.T) {
+	dataDir := t.TempDir()
+
+	id, err := ReadOrCreateFileWithOptions(dataDir, Options{Version: VersionV7})
+	require.NoError(t, err)
+
+	info, err := Parse(id)
+	require.NoError(t, err)
+	require.Equal(t, VersionV7, info.Version)
+
+	var meta metaFile
+	raw, err := os.ReadFile(metaPath(dataDir))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(raw, &meta))
+	require.Equal(t, VersionV7, meta.Version)
+	require.Equal(t, info.CreatedAt, meta.CreatedAt)
+}
+
+// TestReadOrCreateFileWithOptionsBackfillsActualVersion guards against a
+// regression where a missing host_uuid.meta was backfilled using the
+// caller's *currently configured* opts.Version instead of the version
+// actually embedded in the pre-existing UUID -- mislabeling an old v4 host
+// as v7 the moment an operator opts into v7 for new hosts.
+func TestReadOrCreateFileWithOptionsBackfillsActualVersion(t *testing.T) {
+	dataDir := t.TempDir()
+
+	const existingV4ID = "11111111-1111-4111-8111-111111111111"
+	require.NoError(t, WriteFile(dataDir, existingV4ID))
+
+	id, err := ReadOrCreateFileWithOptions(dataDir, Options{Version: VersionV7})
+	require.NoError(t, err)
+	require.Equal(t, existingV4ID, id)
+
+	var meta metaFile
+	raw, err := os.ReadFile(metaPath(dataDir))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(raw, &meta))
+	require.Equal(t, VersionV4, meta.Version)
+}
+
+// TestReadOrCreateFileWithOptionsBackfillsMissingMeta guards against the
+// id already existing but a prior call dying before writeMeta ran: the
+// meta file must be written on the next call rather than staying missing
+// forever.
+func TestReadOrCreateFileWithOptionsBackfillsMissingMeta(t *testing.T) {
+	dataDir := t.TempDir()
+
+	id, err := ReadOrCreateFileWithOptions(dataDir, Options{Version: VersionV4})
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(metaPath(dataDir)))
+
+	again, err := ReadOrCreateFileWithOptions(dataDir, Options{Version: VersionV4})
+	require.NoError(t, err)
+	require.Equal(t, id, again)
+	require.True(t, metaExists(dataDir))
+}
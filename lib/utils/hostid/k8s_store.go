@@ -0,0 +1,103 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package hostid
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gravitational/trace"
+)
+
+// defaultPodUIDPath is where the Kubernetes downward API conventionally
+// projects a pod's UID when mounted as a file, e.g.:
+//
+//	volumes:
+//	  - name: podinfo
+//	    downwardAPI:
+//	      items:
+//	        - path: "uid"
+//	          fieldRef:
+//	            fieldPath: metadata.uid
+const defaultPodUIDPath = "/etc/podinfo/uid"
+
+// podUIDEnvVar is an alternative to the downward API volume: a chart may
+// instead expose the pod UID directly as an environment variable.
+const podUIDEnvVar = "POD_UID"
+
+// k8sMetadataNamespace derives a stable UUID from a pod UID, so the same
+// pod always maps to the same host UUID.
+var k8sMetadataNamespace = uuid.MustParse("7b6e6e2a-3f1a-4d6f-9a7a-1a5e9f5c2b3d")
+
+// K8sDownwardAPIStore is a Store that derives the host UUID from the pod
+// UID Kubernetes assigns this pod, read via the downward API. Because the
+// pod UID is stable for the lifetime of the pod, this lets Teleport
+// running in an ephemeral container keep a consistent identity across
+// restarts without relying on persistent storage.
+type K8sDownwardAPIStore struct {
+	dataDir    string
+	podUIDPath string
+}
+
+// NewK8sDownwardAPIStore returns a Store that derives the host UUID from
+// the pod UID found at /etc/podinfo/uid (downward API convention) or,
+// failing that, the POD_UID environment variable.
+func NewK8sDownwardAPIStore(dataDir string) *K8sDownwardAPIStore {
+	return &K8sDownwardAPIStore{dataDir: dataDir, podUIDPath: defaultPodUIDPath}
+}
+
+// Read implements Store.
+func (s *K8sDownwardAPIStore) Read(ctx context.Context) (string, error) {
+	return ReadFile(s.dataDir)
+}
+
+// WriteIfAbsent implements Store. The id argument is ignored: the host
+// UUID is always derived from the pod UID, not generated randomly.
+func (s *K8sDownwardAPIStore) WriteIfAbsent(ctx context.Context, _ string) (string, error) {
+	if read, err := s.Read(ctx); err == nil {
+		return read, nil
+	} else if !trace.IsNotFound(err) {
+		return "", trace.Wrap(err)
+	}
+
+	podUID, err := s.readPodUID()
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+
+	derived := uuid.NewSHA1(k8sMetadataNamespace, []byte(podUID)).String()
+	if err := WriteFile(s.dataDir, derived); err != nil {
+		return "", trace.Wrap(err)
+	}
+	return derived, nil
+}
+
+func (s *K8sDownwardAPIStore) readPodUID() (string, error) {
+	if contents, err := os.ReadFile(s.podUIDPath); err == nil {
+		if uid := strings.TrimSpace(string(contents)); uid != "" {
+			return uid, nil
+		}
+	}
+
+	if uid := strings.TrimSpace(os.Getenv(podUIDEnvVar)); uid != "" {
+		return uid, nil
+	}
+
+	return "", trace.NotFound("no pod UID found at %s or in %s", s.podUIDPath, podUIDEnvVar)
+}
@@ -0,0 +1,65 @@
+//go:build linux
+
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package hostid
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestK8sDownwardAPIStoreFromPodUIDFile(t *testing.T) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
+
+	podUIDPath := filepath.Join(dataDir, "uid")
+	require.NoError(t, os.WriteFile(podUIDPath, []byte("abc-123\n"), 0o600))
+
+	store := &K8sDownwardAPIStore{dataDir: dataDir, podUIDPath: podUIDPath}
+
+	first, err := store.WriteIfAbsent(ctx, "ignored")
+	require.NoError(t, err)
+	require.NotEmpty(t, first)
+
+	again, err := store.WriteIfAbsent(ctx, "ignored")
+	require.NoError(t, err)
+	require.Equal(t, first, again)
+}
+
+func TestK8sDownwardAPIStoreFromEnv(t *testing.T) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
+
+	t.Setenv(podUIDEnvVar, "abc-123")
+	store := &K8sDownwardAPIStore{dataDir: dataDir, podUIDPath: filepath.Join(dataDir, "missing-uid")}
+
+	id, err := store.WriteIfAbsent(ctx, "ignored")
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+}
+
+func TestK8sDownwardAPIStoreNoPodUID(t *testing.T) {
+	store := &K8sDownwardAPIStore{dataDir: t.TempDir(), podUIDPath: "/does/not/exist"}
+
+	_, err := store.readPodUID()
+	require.Error(t, err)
+}
@@ -0,0 +1,58 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package hostid
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gravitational/trace"
+)
+
+// MemoryStore is a Store backed by a single in-process value. It's intended
+// for tests that need a Store but don't care where the UUID ends up.
+type MemoryStore struct {
+	mu sync.Mutex
+	id string
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Read implements Store.
+func (s *MemoryStore) Read(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.id == "" {
+		return "", trace.NotFound("host uuid is not set")
+	}
+	return s.id, nil
+}
+
+// WriteIfAbsent implements Store.
+func (s *MemoryStore) WriteIfAbsent(ctx context.Context, id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.id == "" {
+		s.id = id
+	}
+	return s.id, nil
+}
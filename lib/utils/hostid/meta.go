@@ -0,0 +1,60 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package hostid
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/google/renameio/v2"
+	"github.com/gravitational/trace"
+)
+
+// metaFile is the JSON document written alongside the host UUID file so
+// that tools can learn how and when the UUID was created without parsing
+// the UUID itself.
+type metaFile struct {
+	Version   Version   `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// metaPath returns the path of the sibling metadata file for the host UUID
+// file at GetPath(dataDir), e.g. ".../host_uuid.meta".
+func metaPath(dataDir string) string {
+	return GetPath(dataDir) + ".meta"
+}
+
+// metaExists reports whether a metadata file has already been written for
+// the host UUID in dataDir.
+func metaExists(dataDir string) bool {
+	_, err := os.Stat(metaPath(dataDir))
+	return err == nil
+}
+
+// writeMeta persists the version and creation time of a freshly generated
+// host UUID.
+func writeMeta(dataDir string, version Version, createdAt time.Time) error {
+	contents, err := json.Marshal(metaFile{Version: version, CreatedAt: createdAt})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if err := renameio.WriteFile(metaPath(dataDir), contents, 0o400); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package hostid persists and retrieves the UUID that identifies this host
+// to the rest of a Teleport cluster, behind a pluggable Store interface
+// with file, cloud-instance-metadata, Kubernetes, and TPM-backed
+// implementations.
+//
+// Wiring a non-default Store into lib/service, tctl, and tbot via a
+// teleport.host_id.source config option is tracked separately; as it
+// stands, callers that want something other than the file-backed default
+// construct a Store directly.
+package hostid
+
+import (
+	"context"
+
+	"github.com/gravitational/trace"
+)
+
+// Store persists and retrieves the UUID that identifies this host to the
+// rest of a Teleport cluster. Implementations are free to root identity in
+// whatever is stable for their environment (a file on disk, cloud instance
+// metadata, a Kubernetes pod UID, ...).
+type Store interface {
+	// Read returns the previously stored host UUID. It returns a
+	// trace.NotFound error if no UUID has been persisted yet.
+	Read(ctx context.Context) (string, error)
+	// WriteIfAbsent persists id as the host UUID, unless a UUID has
+	// already been written, in which case the existing value is
+	// returned instead of id. Implementations must make this atomic
+	// with respect to concurrent callers.
+	//
+	// Backends that derive identity from something other than a random
+	// value (cloud instance metadata, a Kubernetes pod UID, a TPM) may
+	// ignore id entirely and persist their own derived UUID instead --
+	// callers should treat the returned string, not id, as authoritative.
+	WriteIfAbsent(ctx context.Context, id string) (string, error)
+}
+
+// ReadOrCreate returns the host UUID known to store, generating and
+// persisting a new one via store according to opts if none exists yet.
+// This is the single entry point every Store backend shares: it's what
+// gives the file backend, and any future one, the versioned-ID generation
+// and entropy-injection/backoff behavior opts describes, not just
+// FileStore's legacy code path. Backends that derive their own identity
+// (cloud instance metadata, a Kubernetes pod UID, a TPM) ignore the
+// generated id and persist their own value instead, per Store.WriteIfAbsent.
+func ReadOrCreate(ctx context.Context, store Store, opts Options) (string, error) {
+	if read, err := store.Read(ctx); err == nil {
+		return read, nil
+	} else if !trace.IsNotFound(err) {
+		return "", trace.Wrap(err)
+	}
+
+	if opts.Version == 0 {
+		opts.Version = VersionV4
+	}
+
+	rawID, err := generateUUID(opts)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+
+	id, err := store.WriteIfAbsent(ctx, rawID)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	return id, nil
+}
@@ -0,0 +1,79 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package hostid
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gravitational/trace"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	_, err := store.Read(ctx)
+	require.True(t, trace.IsNotFound(err))
+
+	first := uuid.NewString()
+	written, err := store.WriteIfAbsent(ctx, first)
+	require.NoError(t, err)
+	require.Equal(t, first, written)
+
+	// A second WriteIfAbsent must not clobber the first UUID.
+	second := uuid.NewString()
+	written, err = store.WriteIfAbsent(ctx, second)
+	require.NoError(t, err)
+	require.Equal(t, first, written)
+
+	read, err := store.Read(ctx)
+	require.NoError(t, err)
+	require.Equal(t, first, read)
+}
+
+func TestReadOrCreate(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	id, err := ReadOrCreate(ctx, store, Options{})
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+
+	// A second call must return the same UUID the first call generated.
+	again, err := ReadOrCreate(ctx, store, Options{})
+	require.NoError(t, err)
+	require.Equal(t, id, again)
+}
+
+// TestReadOrCreateThreadsOptions guards against a regression where
+// ReadOrCreate generated UUIDs without consulting opts at all, so a
+// Store-based caller couldn't get a versioned ID regardless of what it
+// asked for.
+func TestReadOrCreateThreadsOptions(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	id, err := ReadOrCreate(ctx, store, Options{Version: VersionV7})
+	require.NoError(t, err)
+
+	info, err := Parse(id)
+	require.NoError(t, err)
+	require.Equal(t, VersionV7, info.Version)
+}
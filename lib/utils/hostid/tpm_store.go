@@ -0,0 +1,383 @@
+//go:build linux
+
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package hostid
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/google/renameio/v2"
+	"github.com/google/uuid"
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport/lib/utils"
+)
+
+// sealedBlob is the on-disk representation of a TPM-sealed host UUID: the
+// public/private halves TPM2_Create returned, plus the PCR selection the
+// object's authorization policy is bound to.
+type sealedBlob struct {
+	Public  []byte `json:"public"`
+	Private []byte `json:"private"`
+	PCRs    []int  `json:"pcrs"`
+}
+
+// TPMStore is a Store that seals the host UUID inside a TPM 2.0 device
+// rather than storing it in plaintext on disk. The sealed object's
+// authorization policy is bound to the selected PCRs, so copying dataDir to
+// another machine -- or booting this one after firmware/kernel changes
+// those PCRs -- isn't enough to recover the UUID: the TPM refuses to
+// unseal unless the measured boot state matches what it was sealed under.
+type TPMStore struct {
+	dataDir    string
+	devicePath string
+	pcrs       []int
+}
+
+// NewTPMStore returns a Store that seals the host UUID inside the TPM 2.0
+// device at devicePath (e.g. "/dev/tpmrm0"), binding it to pcrs.
+func NewTPMStore(dataDir, devicePath string, pcrs []int) *TPMStore {
+	return &TPMStore{dataDir: dataDir, devicePath: devicePath, pcrs: pcrs}
+}
+
+func (s *TPMStore) blobPath() string {
+	return GetPath(s.dataDir) + ".tpm"
+}
+
+// readBlob loads the sealed blob from disk without touching the TPM
+// device, so callers that need the device open for more than one
+// operation (Attestation) don't have to open it twice.
+func (s *TPMStore) readBlob() (sealedBlob, error) {
+	raw, err := os.ReadFile(s.blobPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return sealedBlob{}, trace.NotFound("no TPM-sealed host uuid at %s", s.blobPath())
+		}
+		return sealedBlob{}, trace.ConvertSystemError(err)
+	}
+
+	var blob sealedBlob
+	if err := json.Unmarshal(raw, &blob); err != nil {
+		return sealedBlob{}, trace.Wrap(err)
+	}
+	return blob, nil
+}
+
+// Read implements Store by unsealing the existing blob. It fails closed --
+// returning an error rather than a stale or forged UUID -- if the current
+// PCR state no longer matches what the blob was sealed against.
+func (s *TPMStore) Read(ctx context.Context) (string, error) {
+	blob, err := s.readBlob()
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+
+	rw, err := tpm2.OpenTPM(s.devicePath)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	defer rw.Close()
+
+	id, err := s.unseal(rw, blob)
+	if err != nil {
+		return "", trace.Wrap(err, "unsealing host uuid, PCR state may have changed")
+	}
+	return id, nil
+}
+
+// WriteIfAbsent implements Store. The id argument is ignored: the UUID is
+// generated inside the TPM itself via TPM2_GetRandom, so it never exists in
+// plaintext outside the device. It takes an on-disk lock and re-checks for
+// a concurrently-written blob before generating, mirroring the guarantee
+// FileStore.WriteIfAbsent makes for the file backend.
+func (s *TPMStore) WriteIfAbsent(ctx context.Context, _ string) (string, error) {
+	lockPath := s.blobPath() + ".lock"
+	const iterationLimit = 3
+
+	for i := 0; i < iterationLimit; i++ {
+		id, err := func() (string, error) {
+			unlock, err := utils.FSTryWriteLock(lockPath)
+			if err != nil {
+				return "", trace.Wrap(err)
+			}
+			defer unlock()
+
+			if read, err := s.Read(ctx); err == nil {
+				return read, nil
+			} else if !trace.IsNotFound(err) {
+				return "", trace.Wrap(err)
+			}
+
+			return s.generateAndSeal()
+		}()
+		if err != nil {
+			if errors.Is(err, utils.ErrUnsuccessfulLockTry) {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return "", trace.Wrap(err)
+		}
+
+		return id, nil
+	}
+
+	return "", trace.LimitExceeded("failed to obtain host uuid")
+}
+
+// getRandomBytes accumulates exactly n bytes from TPM2_GetRandom, which the
+// spec permits to return fewer bytes than requested in a single call.
+func getRandomBytes(rw io.ReadWriteCloser, n int) ([]byte, error) {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		chunk, err := tpm2.GetRandom(rw, uint16(n-len(out)))
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		if len(chunk) == 0 {
+			return nil, trace.BadParameter("TPM2_GetRandom returned no bytes")
+		}
+		out = append(out, chunk...)
+	}
+	return out, nil
+}
+
+func (s *TPMStore) generateAndSeal() (string, error) {
+	rw, err := tpm2.OpenTPM(s.devicePath)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	defer rw.Close()
+
+	raw, err := getRandomBytes(rw, 16)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	raw[6] = (raw[6] & 0x0f) | 0x40 // version 4
+	raw[8] = (raw[8] & 0x3f) | 0x80 // variant 10
+
+	id, err := uuid.FromBytes(raw)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+
+	blob, err := s.seal(rw, raw)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+
+	contents, err := json.Marshal(blob)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	if err := renameio.WriteFile(s.blobPath(), contents, 0o400); err != nil {
+		return "", trace.ConvertSystemError(err)
+	}
+
+	return id.String(), nil
+}
+
+// Attestation is a TPM2 quote binding the host UUID and PCR state to a
+// verifier-supplied nonce, plus everything a remote verifier needs to check
+// it without trusting anything else this process says about itself.
+type Attestation struct {
+	// AKPublic is the DER-encoded SubjectPublicKeyInfo of the attestation
+	// key that produced Signature, so the verifier knows which key to
+	// check the signature against.
+	AKPublic []byte
+	// Quote is the raw TPMS_ATTEST structure TPM2_Quote produced, encoding
+	// the quoted PCR digest and the qualifying data (host UUID and nonce)
+	// that Signature was computed over.
+	Quote []byte
+	// Signature is the TPM2_Quote signature over Quote.
+	Signature []byte
+}
+
+// Attestation returns a TPM quote over the host UUID and the current PCR
+// state, with nonce folded into the signed qualifying data so a captured
+// Attestation can't be replayed for a different registration attempt. The
+// auth server checks Signature against AKPublic, confirms Quote's
+// qualifying data matches the expected UUID and the nonce it issued, and
+// validates the quoted PCR values during the RegisterUsingToken flow.
+func (s *TPMStore) Attestation(ctx context.Context, nonce []byte) (Attestation, error) {
+	blob, err := s.readBlob()
+	if err != nil {
+		return Attestation{}, trace.Wrap(err)
+	}
+
+	rw, err := tpm2.OpenTPM(s.devicePath)
+	if err != nil {
+		return Attestation{}, trace.Wrap(err)
+	}
+	defer rw.Close()
+
+	id, err := s.unseal(rw, blob)
+	if err != nil {
+		return Attestation{}, trace.Wrap(err, "unsealing host uuid, PCR state may have changed")
+	}
+
+	qualifyingData := append([]byte(id), nonce...)
+	attestation, err := s.quote(rw, qualifyingData)
+	if err != nil {
+		return Attestation{}, trace.Wrap(err)
+	}
+	return attestation, nil
+}
+
+func (s *TPMStore) pcrSelection() tpm2.PCRSelection {
+	return tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: s.pcrs}
+}
+
+// sealingParentTemplate is a restricted, decrypt-only RSA storage key used
+// purely as the parent for Seal/Load -- it is never used to sign or used
+// outside this device, so an empty password is sufficient authorization.
+func sealingParentTemplate() tpm2.Public {
+	return tpm2.Public{
+		Type:    tpm2.AlgRSA,
+		NameAlg: tpm2.AlgSHA256,
+		Attributes: tpm2.FlagFixedTPM | tpm2.FlagFixedParent | tpm2.FlagSensitiveDataOrigin |
+			tpm2.FlagUserWithAuth | tpm2.FlagRestricted | tpm2.FlagDecrypt | tpm2.FlagNoDA,
+		RSAParameters: &tpm2.RSAParams{
+			Symmetric: &tpm2.SymScheme{Alg: tpm2.AlgAES, KeyBits: 128, Mode: tpm2.AlgCFB},
+			KeyBits:   2048,
+		},
+	}
+}
+
+// attestationKeyTemplate is a restricted, sign-only RSA key used to
+// produce TPM2_Quote signatures.
+func attestationKeyTemplate() tpm2.Public {
+	return tpm2.Public{
+		Type:    tpm2.AlgRSA,
+		NameAlg: tpm2.AlgSHA256,
+		Attributes: tpm2.FlagFixedTPM | tpm2.FlagFixedParent | tpm2.FlagSensitiveDataOrigin |
+			tpm2.FlagUserWithAuth | tpm2.FlagRestricted | tpm2.FlagSign | tpm2.FlagNoDA,
+		RSAParameters: &tpm2.RSAParams{
+			Sign:    &tpm2.SigScheme{Alg: tpm2.AlgRSASSA, Hash: tpm2.AlgSHA256},
+			KeyBits: 2048,
+		},
+	}
+}
+
+// pcrPolicyDigest computes the authorization policy digest a sealed object
+// must be created with for TPM2_Unseal to later require the same PCR
+// state, using a trial policy session as TPM2_PolicyPCR expects.
+func (s *TPMStore) pcrPolicyDigest(rw io.ReadWriteCloser) ([]byte, error) {
+	session, _, err := tpm2.StartAuthSession(rw, tpm2.HandleNull, tpm2.HandleNull,
+		make([]byte, 16), nil, tpm2.SessionTrial, tpm2.AlgNull, tpm2.AlgSHA256)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer tpm2.FlushContext(rw, session)
+
+	if err := tpm2.PolicyPCR(rw, session, nil, s.pcrSelection()); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return tpm2.PolicyGetDigest(rw, session)
+}
+
+func (s *TPMStore) seal(rw io.ReadWriteCloser, secret []byte) (sealedBlob, error) {
+	policy, err := s.pcrPolicyDigest(rw)
+	if err != nil {
+		return sealedBlob{}, trace.Wrap(err)
+	}
+
+	parentHandle, _, err := tpm2.CreatePrimary(rw, tpm2.HandleOwner, s.pcrSelection(), "", "", sealingParentTemplate())
+	if err != nil {
+		return sealedBlob{}, trace.Wrap(err)
+	}
+	defer tpm2.FlushContext(rw, parentHandle)
+
+	private, public, err := tpm2.Seal(rw, parentHandle, "", "", policy, secret)
+	if err != nil {
+		return sealedBlob{}, trace.Wrap(err)
+	}
+
+	return sealedBlob{Public: public, Private: private, PCRs: s.pcrs}, nil
+}
+
+func (s *TPMStore) unseal(rw io.ReadWriteCloser, blob sealedBlob) (string, error) {
+	parentHandle, _, err := tpm2.CreatePrimary(rw, tpm2.HandleOwner, s.pcrSelection(), "", "", sealingParentTemplate())
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	defer tpm2.FlushContext(rw, parentHandle)
+
+	objHandle, _, err := tpm2.Load(rw, parentHandle, "", blob.Public, blob.Private)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	defer tpm2.FlushContext(rw, objHandle)
+
+	session, _, err := tpm2.StartAuthSession(rw, tpm2.HandleNull, tpm2.HandleNull,
+		make([]byte, 16), nil, tpm2.SessionPolicy, tpm2.AlgNull, tpm2.AlgSHA256)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	defer tpm2.FlushContext(rw, session)
+
+	if err := tpm2.PolicyPCR(rw, session, nil, s.pcrSelection()); err != nil {
+		return "", trace.Wrap(err)
+	}
+
+	secret, err := tpm2.UnsealWithSession(rw, session, objHandle, "")
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+
+	id, err := uuid.FromBytes(secret)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	return id.String(), nil
+}
+
+// quote produces a TPM2_Quote: a PCR-state attestation signed by a
+// TPM-resident attestation key, with qualifyingData bound into the signed
+// attest structure so a verifier can tell the quote was produced for this
+// specific challenge. It returns the attestation key's public part
+// alongside the raw attested data and signature, since a verifier can't
+// check a signature without either.
+func (s *TPMStore) quote(rw io.ReadWriteCloser, qualifyingData []byte) (Attestation, error) {
+	akHandle, akPublic, err := tpm2.CreatePrimary(rw, tpm2.HandleOwner, s.pcrSelection(), "", "", attestationKeyTemplate())
+	if err != nil {
+		return Attestation{}, trace.Wrap(err)
+	}
+	defer tpm2.FlushContext(rw, akHandle)
+
+	attest, sig, err := tpm2.Quote(rw, akHandle, "", "", qualifyingData, s.pcrSelection(), tpm2.AlgNull)
+	if err != nil {
+		return Attestation{}, trace.Wrap(err)
+	}
+	if sig == nil || sig.RSA == nil {
+		return Attestation{}, trace.BadParameter("TPM2_Quote returned no RSA signature")
+	}
+
+	akPublicDER, err := x509.MarshalPKIXPublicKey(akPublic)
+	if err != nil {
+		return Attestation{}, trace.Wrap(err)
+	}
+
+	return Attestation{AKPublic: akPublicDER, Quote: attest, Signature: sig.RSA.Signature}, nil
+}
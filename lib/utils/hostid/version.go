@@ -0,0 +1,174 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package hostid
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gravitational/trace"
+)
+
+// Version selects the UUID format used when generating a new host ID.
+type Version int
+
+const (
+	// VersionV4 generates a random (RFC 4122 §4.4) UUID. This is the
+	// default, for backward compatibility with existing deployments.
+	VersionV4 Version = 4
+	// VersionV7 generates a Unix-epoch-time-ordered (RFC 9562 §5.7) UUID, so
+	// that host directories, audit log entries, and backend scans keyed by
+	// host UUID sort and list in chronological order.
+	VersionV7 Version = 7
+)
+
+// Options configures how ReadOrCreateFileWithOptions generates a new host
+// UUID.
+type Options struct {
+	// Version selects the UUID format. Defaults to VersionV4.
+	Version Version
+	// RandReader is the entropy source used to generate the UUID. Defaults
+	// to crypto/rand.Reader. Tests can inject a deterministic reader here
+	// for reproducible host IDs.
+	RandReader io.Reader
+	// RandWait bounds how long to retry after a transient error reading
+	// from RandReader, such as /dev/urandom not yet being seeded this early
+	// in the boot process. Defaults to 30 seconds.
+	RandWait time.Duration
+}
+
+// defaultRandWait is how long ReadOrCreateFileWithOptions retries reading
+// from the entropy source before giving up, when Options.RandWait is unset.
+const defaultRandWait = 30 * time.Second
+
+// minRandBackoff and maxRandBackoff bound the exponential backoff between
+// retries while waiting for the entropy source to become ready.
+const (
+	minRandBackoff = 50 * time.Millisecond
+	maxRandBackoff = time.Second
+)
+
+// Info describes a host UUID, including whatever can be recovered from the
+// UUID itself.
+type Info struct {
+	// Version is the UUID format the host UUID was generated with.
+	Version Version
+	// CreatedAt is the time the host UUID was generated, recovered from the
+	// embedded timestamp. It is the zero value for UUIDs that don't encode
+	// a timestamp (VersionV4).
+	CreatedAt time.Time
+}
+
+// Parse extracts Info from a host UUID, decoding the embedded timestamp
+// when the UUID is a VersionV7 id.
+func Parse(id string) (Info, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return Info{}, trace.Wrap(err)
+	}
+
+	info := Info{Version: Version(parsed.Version())}
+	if info.Version == VersionV7 {
+		var ms uint64
+		for _, b := range parsed[:6] {
+			ms = ms<<8 | uint64(b)
+		}
+		info.CreatedAt = time.UnixMilli(int64(ms)).UTC()
+	}
+	return info, nil
+}
+
+// GenerateUUIDWithReader generates a new host UUID in the requested format,
+// reading entropy from r instead of assuming crypto/rand.Reader. It exists
+// as its own entry point so tests can supply a deterministic reader and get
+// reproducible host IDs.
+func GenerateUUIDWithReader(version Version, r io.Reader) (string, error) {
+	var u uuid.UUID
+
+	if version != VersionV7 {
+		if _, err := io.ReadFull(r, u[:]); err != nil {
+			return "", trace.Wrap(err)
+		}
+		u[6] = (u[6] & 0x0f) | 0x40 // version 4
+		u[8] = (u[8] & 0x3f) | 0x80 // variant 10
+		return u.String(), nil
+	}
+
+	ms := uint64(time.Now().UnixMilli())
+	u[0] = byte(ms >> 40)
+	u[1] = byte(ms >> 32)
+	u[2] = byte(ms >> 24)
+	u[3] = byte(ms >> 16)
+	u[4] = byte(ms >> 8)
+	u[5] = byte(ms)
+
+	if _, err := io.ReadFull(r, u[6:]); err != nil {
+		return "", trace.Wrap(err)
+	}
+	u[6] = (u[6] & 0x0f) | 0x70 // version 7
+	u[8] = (u[8] & 0x3f) | 0x80 // variant 10
+
+	return u.String(), nil
+}
+
+// generateUUID returns a new host UUID according to opts, retrying with
+// exponential backoff (capped at maxRandBackoff) while opts.RandReader
+// returns a transient error, up to opts.RandWait. This is the case, for
+// instance, when Teleport starts very early in the node initialization
+// cycle and /dev/urandom isn't seeded yet: rather than hard-failing and
+// asking the operator to restart, systemd units ordered after
+// systemd-random-seed.service get a chance to finish first.
+func generateUUID(opts Options) (string, error) {
+	reader := opts.RandReader
+	if reader == nil {
+		reader = rand.Reader
+	}
+	wait := opts.RandWait
+	if wait <= 0 {
+		wait = defaultRandWait
+	}
+
+	deadline := time.Now().Add(wait)
+	backoff := minRandBackoff
+	for {
+		id, err := GenerateUUIDWithReader(opts.Version, reader)
+		if err == nil {
+			return id, nil
+		}
+		if !isTransientRandError(err) || time.Now().After(deadline) {
+			return "", trace.BadParameter("" +
+				"Teleport failed to generate host UUID. " +
+				"This may happen if randomness source is not fully initialized when the node is starting up. " +
+				"Please try restarting Teleport again.")
+		}
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxRandBackoff {
+			backoff = maxRandBackoff
+		}
+	}
+}
+
+// isTransientRandError reports whether err looks like a transient failure
+// to read from an entropy source that simply isn't ready yet, as opposed to
+// a permanent misconfiguration.
+func isTransientRandError(err error) bool {
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
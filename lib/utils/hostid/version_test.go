@@ -0,0 +1,63 @@
+// Teleport
+// Copyright (C) 2024 Gravitational, Inc.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package hostid
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateUUIDWithReaderAndParse(t *testing.T) {
+	t.Run("v4", func(t *testing.T) {
+		id, err := GenerateUUIDWithReader(VersionV4, rand.Reader)
+		require.NoError(t, err)
+
+		parsed, err := uuid.Parse(id)
+		require.NoError(t, err)
+		require.Equal(t, uuid.Version(4), parsed.Version())
+
+		info, err := Parse(id)
+		require.NoError(t, err)
+		require.Equal(t, VersionV4, info.Version)
+		require.True(t, info.CreatedAt.IsZero())
+	})
+
+	t.Run("v7", func(t *testing.T) {
+		before := time.Now().Add(-time.Second)
+
+		id, err := GenerateUUIDWithReader(VersionV7, rand.Reader)
+		require.NoError(t, err)
+
+		parsed, err := uuid.Parse(id)
+		require.NoError(t, err)
+		require.Equal(t, uuid.Version(7), parsed.Version())
+
+		info, err := Parse(id)
+		require.NoError(t, err)
+		require.Equal(t, VersionV7, info.Version)
+		require.WithinRange(t, info.CreatedAt, before, time.Now().Add(time.Second))
+	})
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse("not-a-uuid")
+	require.Error(t, err)
+}